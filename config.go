@@ -0,0 +1,121 @@
+package s3vfs
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Config configures how an S3FS authenticates and connects to S3 (or an
+// S3-compatible endpoint).
+//
+// The zero value is valid and resolves credentials using the default AWS
+// SDK provider chain: environment variables, the shared config/credentials
+// files, and EC2/ECS instance metadata, in that order.
+type Config struct {
+	// Region is the AWS region to sign requests for (e.g. "us-west-2"). If
+	// empty, it is resolved from the shared config file or the
+	// AWS_REGION/AWS_DEFAULT_REGION environment variables.
+	Region string
+
+	// Endpoint overrides the default AWS S3 endpoint, for use with
+	// S3-compatible services such as MinIO or Ceph RGW.
+	Endpoint string
+
+	// ForcePathStyle requests path-style addressing (https://host/bucket/key)
+	// instead of virtual-hosted-style (https://bucket.host/key). Most
+	// non-AWS S3-compatible services require this.
+	ForcePathStyle bool
+
+	// Credentials supplies the credential provider used to sign requests.
+	// If nil, the default provider chain is used (see Config doc above).
+	// Use StaticCredentials for a fixed access/secret key pair.
+	Credentials aws.CredentialsProvider
+
+	// AssumeRoleARN, if non-empty, wraps Credentials (or the default
+	// chain, if Credentials is nil) so that requests are signed with
+	// temporary credentials obtained by assuming this IAM role via STS.
+	AssumeRoleARN string
+
+	// HTTPClient is the HTTP client used for all requests. If nil, the AWS
+	// SDK's default HTTP client is used.
+	HTTPClient *http.Client
+
+	// PartSize is the size, in bytes, of each part uploaded by
+	// S3FS.Create. It defaults to DefaultPartSize and is raised to
+	// MinPartSize if set lower, since S3 rejects smaller non-final parts.
+	PartSize int64
+
+	// UploadConcurrency is the number of parts S3FS.Create uploads in
+	// parallel. It defaults to DefaultUploadConcurrency if zero.
+	UploadConcurrency int
+
+	// ReadAheadSize is the minimum number of bytes S3FS.Open fetches per
+	// range GET, so that small sequential reads are coalesced into fewer,
+	// larger requests. It defaults to DefaultReadAheadSize if zero.
+	ReadAheadSize int64
+
+	// RemoveConcurrency is the number of DeleteObjects batch requests
+	// S3FS.RemoveAll and S3FS.RemoveBatch issue in parallel. It defaults
+	// to 1 (sequential) if zero.
+	RemoveConcurrency int
+}
+
+// DefaultConfig is used by S3 when no config is supplied.
+var DefaultConfig = &Config{}
+
+// StaticCredentials returns a credential provider for a fixed access key,
+// secret key, and (optional) session token, for use as Config.Credentials.
+func StaticCredentials(accessKeyID, secretAccessKey, sessionToken string) aws.CredentialsProvider {
+	return credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, sessionToken)
+}
+
+// awsConfig builds the aws-sdk-go-v2 Config used to construct the S3
+// client, applying any overrides set on c.
+func (c *Config) awsConfig(ctx context.Context) (aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if c.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(c.Region))
+	}
+	if c.Credentials != nil {
+		opts = append(opts, awsconfig.WithCredentialsProvider(c.Credentials))
+	}
+	if c.HTTPClient != nil {
+		opts = append(opts, awsconfig.WithHTTPClient(c.HTTPClient))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	if c.AssumeRoleARN != "" {
+		cfg.Credentials = aws.NewCredentialsCache(
+			stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), c.AssumeRoleARN),
+		)
+	}
+
+	return cfg, nil
+}
+
+// newClient constructs the S3 client used for all requests, applying the
+// endpoint and path-style overrides set on c. All requests made with it are
+// signed using AWS Signature V4.
+func (c *Config) newClient(ctx context.Context) (*s3.Client, error) {
+	cfg, err := c.awsConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if c.Endpoint != "" {
+			o.BaseEndpoint = aws.String(c.Endpoint)
+		}
+		o.UsePathStyle = c.ForcePathStyle
+	}), nil
+}
@@ -0,0 +1,138 @@
+package s3vfs
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ReadDir lists the immediate children of path, following pagination
+// (ContinuationToken) until the listing is exhausted. Subdirectories are
+// derived from CommonPrefixes (via Delimiter "/") rather than enumerated
+// recursively, so ReadDir of a "directory" with millions of descendants
+// still costs O(children), not O(descendants).
+func (fs *S3FS) ReadDir(path string) ([]os.FileInfo, error) {
+	ctx := context.Background()
+	client, err := fs.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fs.key(path)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var fis []os.FileInfo
+	var token *string
+	for {
+		out, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(fs.bucketName()),
+			Prefix:            aws.String(prefix),
+			Delimiter:         aws.String("/"),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return nil, &os.PathError{Op: "readdir", Path: fs.url(path), Err: err}
+		}
+
+		for _, p := range out.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(aws.ToString(p.Prefix), prefix), "/")
+			fis = append(fis, &fileInfo{name: name, mode: os.ModeDir})
+		}
+		for _, obj := range out.Contents {
+			key := aws.ToString(obj.Key)
+			if key == prefix {
+				continue
+			}
+			fis = append(fis, &fileInfo{
+				name:    strings.TrimPrefix(key, prefix),
+				size:    aws.ToInt64(obj.Size),
+				modTime: aws.ToTime(obj.LastModified),
+			})
+		}
+
+		if !aws.ToBool(out.IsTruncated) {
+			break
+		}
+		token = out.NextContinuationToken
+	}
+	return fis, nil
+}
+
+// WalkFunc is called once per object visited by Walk, with path relative to
+// root and the object's FileInfo.
+type WalkFunc func(path string, fi os.FileInfo) error
+
+// WalkPageFunc is called once per page of objects visited by WalkPage,
+// so that callers can parallelize work across a page.
+type WalkPageFunc func(page []os.FileInfo) error
+
+// Walk streams every object under root (its entire subtree, however deep)
+// to fn, in listing order. Unlike ReadDir, it lists with no delimiter, so a
+// single ListObjectsV2 pagination walks the whole subtree in O(descendants)
+// requests rather than descending directory by directory.
+func (fs *S3FS) Walk(root string, fn WalkFunc) error {
+	return fs.WalkPage(root, func(page []os.FileInfo) error {
+		for _, fi := range page {
+			if err := fn(fi.Name(), fi); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WalkPage is like Walk, but invokes fn once per ListObjectsV2 page (up to
+// 1000 objects) instead of once per object, so callers can parallelize
+// processing of a page's objects.
+func (fs *S3FS) WalkPage(root string, fn WalkPageFunc) error {
+	ctx := context.Background()
+	client, err := fs.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	prefix := fs.key(root)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var token *string
+	for {
+		out, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(fs.bucketName()),
+			Prefix:            aws.String(prefix),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return &os.PathError{Op: "walk", Path: fs.url(root), Err: err}
+		}
+
+		page := make([]os.FileInfo, 0, len(out.Contents))
+		for _, obj := range out.Contents {
+			key := aws.ToString(obj.Key)
+			if key == prefix {
+				continue
+			}
+			page = append(page, &fileInfo{
+				name:    strings.TrimPrefix(key, prefix),
+				size:    aws.ToInt64(obj.Size),
+				modTime: aws.ToTime(obj.LastModified),
+			})
+		}
+		if len(page) > 0 {
+			if err := fn(page); err != nil {
+				return err
+			}
+		}
+
+		if !aws.ToBool(out.IsTruncated) {
+			return nil
+		}
+		token = out.NextContinuationToken
+	}
+}
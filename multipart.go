@@ -0,0 +1,366 @@
+package s3vfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// DefaultPartSize is the part size S3FS.Create uses when Config.PartSize is
+// unset.
+const DefaultPartSize int64 = 5 * 1024 * 1024 // 5 MiB
+
+// MinPartSize is the smallest part size S3 accepts for all but the final
+// part of a multipart upload. Config.PartSize is raised to this if set
+// lower.
+const MinPartSize int64 = 5 * 1024 * 1024
+
+// DefaultUploadConcurrency is the number of parts S3FS.Create uploads in
+// parallel when Config.UploadConcurrency is unset.
+const DefaultUploadConcurrency = 5
+
+// CreateOption configures an individual S3FS.CreateWithContext call, such
+// as the server-side encryption applied to the resulting object.
+type CreateOption func(*createOptions)
+
+type createOptions struct {
+	sse                  types.ServerSideEncryption
+	sseKMSKeyID          string
+	sseCustomerAlgorithm string
+	sseCustomerKey       string
+	sseCustomerKeyMD5    string
+}
+
+// WithServerSideEncryption requests SSE-S3 (sse == types.ServerSideEncryptionAes256)
+// or SSE-KMS (sse == types.ServerSideEncryptionAwsKms, paired with
+// WithSSEKMSKeyID) encryption of the object.
+func WithServerSideEncryption(sse types.ServerSideEncryption) CreateOption {
+	return func(o *createOptions) { o.sse = sse }
+}
+
+// WithSSEKMSKeyID requests SSE-KMS encryption using the given CMK key ID or
+// ARN.
+func WithSSEKMSKeyID(keyID string) CreateOption {
+	return func(o *createOptions) {
+		o.sse = types.ServerSideEncryptionAwsKms
+		o.sseKMSKeyID = keyID
+	}
+}
+
+// WithSSECustomerKey requests SSE-C encryption using the given 256-bit
+// customer-supplied key. The same key must be presented to decrypt the
+// object again.
+func WithSSECustomerKey(key []byte) CreateOption {
+	return func(o *createOptions) {
+		sum := md5.Sum(key)
+		o.sseCustomerAlgorithm = "AES256"
+		o.sseCustomerKey = base64.StdEncoding.EncodeToString(key)
+		o.sseCustomerKeyMD5 = base64.StdEncoding.EncodeToString(sum[:])
+	}
+}
+
+func (o createOptions) applyToCreateMultipart(in *s3.CreateMultipartUploadInput) {
+	if o.sse != "" {
+		in.ServerSideEncryption = o.sse
+	}
+	if o.sseKMSKeyID != "" {
+		in.SSEKMSKeyId = aws.String(o.sseKMSKeyID)
+	}
+	o.applySSECustomerKey(&in.SSECustomerAlgorithm, &in.SSECustomerKey, &in.SSECustomerKeyMD5)
+}
+
+func (o createOptions) applyToUploadPart(in *s3.UploadPartInput) {
+	o.applySSECustomerKey(&in.SSECustomerAlgorithm, &in.SSECustomerKey, &in.SSECustomerKeyMD5)
+}
+
+func (o createOptions) applyToPutObject(in *s3.PutObjectInput) {
+	if o.sse != "" {
+		in.ServerSideEncryption = o.sse
+	}
+	if o.sseKMSKeyID != "" {
+		in.SSEKMSKeyId = aws.String(o.sseKMSKeyID)
+	}
+	o.applySSECustomerKey(&in.SSECustomerAlgorithm, &in.SSECustomerKey, &in.SSECustomerKeyMD5)
+}
+
+func (o createOptions) applySSECustomerKey(algorithm, key, keyMD5 **string) {
+	if o.sseCustomerAlgorithm == "" {
+		return
+	}
+	*algorithm = aws.String(o.sseCustomerAlgorithm)
+	*key = aws.String(o.sseCustomerKey)
+	*keyMD5 = aws.String(o.sseCustomerKeyMD5)
+}
+
+// Create opens the file at path for writing, creating the file if it doesn't
+// exist and truncating it otherwise. The returned io.WriteCloser streams
+// writes to S3 as a multipart upload, so arbitrarily large files can be
+// written without buffering them entirely in memory.
+func (fs *S3FS) Create(path string) (io.WriteCloser, error) {
+	return fs.CreateWithContext(context.Background(), path)
+}
+
+// CreateWithContext is like Create, but allows the caller to bound the
+// upload's lifetime (cancellation aborts any in-progress multipart upload)
+// and to set per-object options such as server-side encryption.
+func (fs *S3FS) CreateWithContext(ctx context.Context, path string, opts ...CreateOption) (io.WriteCloser, error) {
+	client, err := fs.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var o createOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	partSize := fs.config.PartSize
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	if partSize < MinPartSize {
+		partSize = MinPartSize
+	}
+
+	concurrency := fs.config.UploadConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultUploadConcurrency
+	}
+
+	w := &multipartWriter{
+		ctx:      ctx,
+		client:   client,
+		bucket:   fs.bucketName(),
+		key:      fs.key(path),
+		partSize: partSize,
+		opts:     o,
+		sem:      make(chan struct{}, concurrency),
+		buf:      make([]byte, 0, partSize),
+		stopCh:   make(chan struct{}),
+	}
+	go w.watchCancel()
+	return w, nil
+}
+
+// multipartWriter is an io.WriteCloser that streams writes to S3. Writes are
+// buffered up to partSize; once the buffer first fills to partSize, a
+// multipart upload is started and parts are uploaded concurrently (bounded by
+// sem) each time the buffer fills. If Close is reached before the buffer ever
+// fills, the buffered data is written with a single PutObject instead.
+type multipartWriter struct {
+	ctx      context.Context
+	client   *s3.Client
+	bucket   string
+	key      string
+	partSize int64
+	opts     createOptions
+
+	buf      []byte
+	uploadID string
+	partNum  int32
+	sem      chan struct{}
+	wg       sync.WaitGroup
+
+	// stopCh is closed as soon as Close is called, to stop watchCancel; from
+	// then on Close handles any abort itself, so cancellation observed
+	// afterward doesn't race with (or redundantly abort) the upload Close is
+	// finishing.
+	stopCh chan struct{}
+
+	mu       sync.Mutex
+	parts    []types.CompletedPart
+	firstErr error
+
+	closed bool
+}
+
+func (w *multipartWriter) Write(p []byte) (int, error) {
+	if err := w.err(); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		room := w.partSize - int64(len(w.buf))
+		if int64(len(p)) < room {
+			w.buf = append(w.buf, p...)
+			written += len(p)
+			break
+		}
+
+		w.buf = append(w.buf, p[:room]...)
+		p = p[room:]
+		written += int(room)
+
+		if w.uploadID == "" {
+			if err := w.startMultipart(); err != nil {
+				return written, err
+			}
+		}
+		full := w.buf
+		w.buf = make([]byte, 0, w.partSize)
+		w.flushPartAsync(full)
+	}
+	return written, w.err()
+}
+
+func (w *multipartWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	close(w.stopCh)
+
+	if w.uploadID == "" {
+		if err := w.err(); err != nil {
+			return err
+		}
+		return w.putSingle()
+	}
+
+	if len(w.buf) > 0 {
+		final := w.buf
+		w.buf = nil
+		w.flushPartAsync(final)
+	}
+	w.wg.Wait()
+
+	if err := w.err(); err != nil {
+		w.abortMultipart()
+		return err
+	}
+
+	sort.Slice(w.parts, func(i, j int) bool {
+		return aws.ToInt32(w.parts[i].PartNumber) < aws.ToInt32(w.parts[j].PartNumber)
+	})
+
+	_, err := w.client.CompleteMultipartUpload(w.ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(w.bucket),
+		Key:             aws.String(w.key),
+		UploadId:        aws.String(w.uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: w.parts},
+	})
+	if err != nil {
+		w.abortMultipart()
+		return err
+	}
+	return nil
+}
+
+func (w *multipartWriter) startMultipart() error {
+	in := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(w.bucket),
+		Key:    aws.String(w.key),
+	}
+	w.opts.applyToCreateMultipart(in)
+
+	out, err := w.client.CreateMultipartUpload(w.ctx, in)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.uploadID = aws.ToString(out.UploadId)
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *multipartWriter) flushPartAsync(data []byte) {
+	partNumber := atomic.AddInt32(&w.partNum, 1)
+
+	w.sem <- struct{}{}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() { <-w.sem }()
+
+		if w.err() != nil {
+			return
+		}
+
+		in := &s3.UploadPartInput{
+			Bucket:     aws.String(w.bucket),
+			Key:        aws.String(w.key),
+			UploadId:   aws.String(w.uploadID),
+			PartNumber: aws.Int32(partNumber),
+			Body:       bytes.NewReader(data),
+		}
+		w.opts.applyToUploadPart(in)
+
+		out, err := w.client.UploadPart(w.ctx, in)
+		if err != nil {
+			w.setErr(err)
+			w.abortMultipart()
+			return
+		}
+
+		w.mu.Lock()
+		w.parts = append(w.parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(partNumber)})
+		w.mu.Unlock()
+	}()
+}
+
+func (w *multipartWriter) putSingle() error {
+	in := &s3.PutObjectInput{
+		Bucket: aws.String(w.bucket),
+		Key:    aws.String(w.key),
+		Body:   bytes.NewReader(w.buf),
+	}
+	w.opts.applyToPutObject(in)
+	_, err := w.client.PutObject(w.ctx, in)
+	return err
+}
+
+// abortMultipart best-effort aborts the in-progress multipart upload so S3
+// doesn't bill for its orphaned parts. It is called when a part upload
+// fails, when the upload's context is canceled (whether or not Close is
+// ever called), or when Close observes either of those after the fact.
+func (w *multipartWriter) abortMultipart() {
+	w.mu.Lock()
+	uploadID := w.uploadID
+	w.mu.Unlock()
+	if uploadID == "" {
+		return
+	}
+	_, _ = w.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(w.bucket),
+		Key:      aws.String(w.key),
+		UploadId: aws.String(uploadID),
+	})
+}
+
+// watchCancel aborts the multipart upload as soon as ctx is canceled, even
+// if the caller never calls Close (e.g. abandons the writer, or cancels ctx
+// instead of calling Close to unwind). It exits once Close signals stopCh,
+// which happens before Close performs its own (redundant but harmless)
+// error-triggered abort.
+func (w *multipartWriter) watchCancel() {
+	select {
+	case <-w.ctx.Done():
+		w.setErr(w.ctx.Err())
+		w.abortMultipart()
+	case <-w.stopCh:
+	}
+}
+
+func (w *multipartWriter) setErr(err error) {
+	w.mu.Lock()
+	if w.firstErr == nil {
+		w.firstErr = err
+	}
+	w.mu.Unlock()
+}
+
+func (w *multipartWriter) err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.firstErr
+}
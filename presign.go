@@ -0,0 +1,125 @@
+package s3vfs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// PresignedRequest describes a SigV4 query-string-signed URL: the URL
+// itself, the HTTP method it must be sent with, and any headers the signer
+// included in the signature (which the caller must send unmodified).
+type PresignedRequest struct {
+	URL          string
+	Method       string
+	SignedHeader http.Header
+}
+
+// PresignGet returns a SigV4 query-string-signed GET URL for name, usable
+// by browsers or other HTTP clients without AWS credentials, valid for
+// expires.
+func (fs *S3FS) PresignGet(name string, expires time.Duration) (string, error) {
+	req, err := fs.PresignedRequest(http.MethodGet, name, expires, nil)
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+// PresignPut is like PresignGet, but returns a signed PUT URL for uploading
+// name. If contentType is non-empty, it is included in the signature, and
+// the caller must send it as the Content-Type header of the PUT.
+func (fs *S3FS) PresignPut(name string, expires time.Duration, contentType string) (string, error) {
+	var headers http.Header
+	if contentType != "" {
+		headers = http.Header{"Content-Type": []string{contentType}}
+	}
+	req, err := fs.PresignedRequest(http.MethodPut, name, expires, headers)
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+// PresignedRequest generates a SigV4 query-string-signed URL (with
+// X-Amz-Algorithm/Credential/Date/Expires/SignedHeaders in the query string,
+// and an unsigned payload) for method on name, valid for expires. Extra
+// headers to include in the signature (e.g. Content-Type for a PUT) are
+// given via headers; the caller must send those same headers when using the
+// URL. Supported methods are GET, PUT, HEAD, and DELETE; PUT supports
+// Content-Type, and the other methods support no headers. headers
+// containing anything else returns an error rather than silently signing a
+// request that doesn't reflect what was asked for.
+func (fs *S3FS) PresignedRequest(method, name string, expires time.Duration, headers http.Header) (*PresignedRequest, error) {
+	ctx := context.Background()
+	client, err := fs.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	presign := s3.NewPresignClient(client, func(o *s3.PresignOptions) {
+		o.Expires = expires
+	})
+
+	bucket := aws.String(fs.bucketName())
+	key := aws.String(fs.key(name))
+
+	var out *v4.PresignedHTTPRequest
+	switch method {
+	case http.MethodGet:
+		if err := requireConsumedHeaders(headers); err != nil {
+			return nil, err
+		}
+		out, err = presign.PresignGetObject(ctx, &s3.GetObjectInput{Bucket: bucket, Key: key})
+	case http.MethodPut:
+		in := &s3.PutObjectInput{Bucket: bucket, Key: key}
+		remaining := headers.Clone()
+		if ct := remaining.Get("Content-Type"); ct != "" {
+			in.ContentType = aws.String(ct)
+			remaining.Del("Content-Type")
+		}
+		if err := requireConsumedHeaders(remaining); err != nil {
+			return nil, err
+		}
+		out, err = presign.PresignPutObject(ctx, in)
+	case http.MethodHead:
+		if err := requireConsumedHeaders(headers); err != nil {
+			return nil, err
+		}
+		out, err = presign.PresignHeadObject(ctx, &s3.HeadObjectInput{Bucket: bucket, Key: key})
+	case http.MethodDelete:
+		if err := requireConsumedHeaders(headers); err != nil {
+			return nil, err
+		}
+		out, err = presign.PresignDeleteObject(ctx, &s3.DeleteObjectInput{Bucket: bucket, Key: key})
+	default:
+		return nil, fmt.Errorf("s3vfs: presigning method %q is not supported", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &PresignedRequest{URL: out.URL, Method: out.Method, SignedHeader: out.SignedHeader}, nil
+}
+
+// requireConsumedHeaders returns an error if headers has any entries left in
+// it after the caller (PresignedRequest) has Del'd the ones it knows how to
+// fold into the signed request for the method in question. This guards
+// against silently dropping a header the caller asked to have signed.
+func requireConsumedHeaders(headers http.Header) error {
+	if len(headers) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("s3vfs: presigning does not support header(s) %s", strings.Join(names, ", "))
+}
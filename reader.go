@@ -0,0 +1,154 @@
+package s3vfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DefaultReadAheadSize is the minimum number of bytes s3Reader fetches per
+// range GET when Config.ReadAheadSize is unset. Coalescing small sequential
+// reads into a single larger range request amortizes per-request latency.
+const DefaultReadAheadSize int64 = 1024 * 1024 // 1 MiB
+
+func (fs *S3FS) readAheadSize() int64 {
+	if fs.config.ReadAheadSize > 0 {
+		return fs.config.ReadAheadSize
+	}
+	return DefaultReadAheadSize
+}
+
+// s3Reader is a vfs.ReadSeekCloser and io.ReaderAt backed by HTTP Range GETs
+// issued on demand, so opening (and seeking within) a large object never
+// requires buffering it in full. The object's length is fetched lazily (via
+// a HEAD request) the first time it's needed, e.g. by Seek(whence=io.SeekEnd).
+//
+// Reads are served from a single cached window [cacheStart, cacheEnd); a
+// miss triggers a new range GET of readAhead bytes starting at the requested
+// offset (or of the whole request, if that is larger), so sequential reads
+// smaller than readAhead result in one range GET per readAhead bytes rather
+// than one per Read call.
+type s3Reader struct {
+	ctx       context.Context
+	fs        *S3FS
+	name      string
+	versionID string
+	readAhead int64
+
+	mu         sync.Mutex
+	pos        int64
+	size       int64 // -1 until known
+	sizeErr    error
+	cacheStart int64
+	cacheEnd   int64
+	cacheBuf   []byte
+}
+
+func (r *s3Reader) sizeLocked() (int64, error) {
+	if r.size < 0 && r.sizeErr == nil {
+		r.size, r.sizeErr = r.fs.headContentLength(r.ctx, r.name, r.versionID)
+	}
+	return r.size, r.sizeErr
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, err := r.readAtLocked(p, r.pos)
+	r.pos += int64(n)
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt for random access, independent of the
+// current Read/Seek position.
+func (r *s3Reader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.readAtLocked(p, off)
+}
+
+func (r *s3Reader) readAtLocked(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	size, err := r.sizeLocked()
+	if err != nil {
+		return 0, err
+	}
+	if off >= size {
+		return 0, io.EOF
+	}
+
+	want := off + int64(len(p))
+	if want > size {
+		want = size
+	}
+
+	if !r.cachedLocked(off, want) {
+		fetchEnd := off + r.readAhead
+		if fetchEnd < want {
+			fetchEnd = want
+		}
+		if fetchEnd > size {
+			fetchEnd = size
+		}
+		if err := r.fetchLocked(off, fetchEnd); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.cacheBuf[off-r.cacheStart:])
+	if off+int64(n) >= size {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *s3Reader) cachedLocked(start, end int64) bool {
+	return r.cacheBuf != nil && start >= r.cacheStart && end <= r.cacheEnd
+}
+
+func (r *s3Reader) fetchLocked(start, end int64) error {
+	data, err := r.fs.getRange(r.ctx, r.name, r.versionID, start, end-1)
+	if err != nil {
+		return err
+	}
+	r.cacheStart = start
+	r.cacheBuf = data
+	r.cacheEnd = start + int64(len(data))
+	return nil
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+		r.pos = offset
+	case io.SeekCurrent:
+		r.pos += offset
+	case io.SeekEnd:
+		size, err := r.sizeLocked()
+		if err != nil {
+			return 0, err
+		}
+		r.pos = size + offset
+	default:
+		return 0, fmt.Errorf("s3vfs: invalid whence %d", whence)
+	}
+	if r.pos < 0 {
+		return 0, errors.New("s3vfs: negative seek position")
+	}
+	return r.pos, nil
+}
+
+func (r *s3Reader) Close() error {
+	r.mu.Lock()
+	r.cacheBuf = nil
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,211 @@
+package s3vfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	pathpkg "path"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// maxDeleteObjectsBatch is the largest number of keys S3's DeleteObjects
+// accepts in a single request.
+const maxDeleteObjectsBatch = 1000
+
+// RemoveError describes the failure to remove a single key, as reported by
+// DeleteObjects' per-key Errors array.
+type RemoveError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+func (e *RemoveError) Error() string {
+	return fmt.Sprintf("remove %s: %s (%s)", e.Key, e.Message, e.Code)
+}
+
+// MultiRemoveError reports per-key failures from one or more DeleteObjects
+// batches. It does not imply that every key failed; keys not listed
+// succeeded.
+type MultiRemoveError []*RemoveError
+
+func (m MultiRemoveError) Error() string {
+	msgs := make([]string, len(m))
+	for i, e := range m {
+		msgs[i] = e.Error()
+	}
+	return fmt.Sprintf("%d of the keys failed to be removed: %s", len(m), strings.Join(msgs, "; "))
+}
+
+// RemoveAll removes every object under name+"/" (name's entire subtree),
+// using paginated listing (see Walk) and batched DeleteObjects requests (up
+// to maxDeleteObjectsBatch keys per request). It also removes name itself if
+// it names an object directly (e.g. a single file rather than a
+// "directory"), since WalkPage only lists descendants under name+"/" and so
+// wouldn't otherwise touch it. A per-key failure does not abort the rest of
+// the removal; the returned MultiRemoveError (if any) reports exactly which
+// keys failed.
+func (fs *S3FS) RemoveAll(name string) error {
+	ctx := context.Background()
+	sem := make(chan struct{}, fs.removeConcurrency())
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs MultiRemoveError
+	var firstErr error
+
+	walkErr := fs.WalkPage(name, func(page []os.FileInfo) error {
+		keys := make([]string, len(page))
+		for i, fi := range page {
+			keys[i] = fs.key(pathpkg.Join(name, fi.Name()))
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			batchErrs, err := fs.deleteObjectsBatch(ctx, keys)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			errs = append(errs, batchErrs...)
+		}()
+		return nil
+	})
+	wg.Wait()
+
+	if walkErr != nil {
+		return walkErr
+	}
+
+	// Deleting a nonexistent key is not an error in S3, so it's safe to
+	// always attempt this rather than first checking whether name is a
+	// "directory" prefix or an exact object key.
+	if key := fs.key(name); key != "" {
+		batchErrs, err := fs.deleteObjectsBatch(ctx, []string{key})
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			errs = append(errs, batchErrs...)
+		}
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// RemoveBatch removes the named objects, splitting them into batches of up
+// to maxDeleteObjectsBatch and issuing DeleteObjects requests for each. Like
+// RemoveAll, a per-key failure does not abort the rest of the batch.
+func (fs *S3FS) RemoveBatch(names []string) error {
+	ctx := context.Background()
+	sem := make(chan struct{}, fs.removeConcurrency())
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs MultiRemoveError
+	var firstErr error
+
+	for i := 0; i < len(names); i += maxDeleteObjectsBatch {
+		end := i + maxDeleteObjectsBatch
+		if end > len(names) {
+			end = len(names)
+		}
+
+		keys := make([]string, end-i)
+		for j, n := range names[i:end] {
+			keys[j] = fs.key(n)
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			batchErrs, err := fs.deleteObjectsBatch(ctx, keys)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			errs = append(errs, batchErrs...)
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// deleteObjectsBatch issues a single DeleteObjects request for keys (which
+// must number no more than maxDeleteObjectsBatch). The returned
+// MultiRemoveError reports per-key failures from the response; the returned
+// error is non-nil only if the request itself failed.
+func (fs *S3FS) deleteObjectsBatch(ctx context.Context, keys []string) (MultiRemoveError, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	client, err := fs.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := make([]types.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		objs[i] = types.ObjectIdentifier{Key: aws.String(key)}
+	}
+
+	out, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(fs.bucketName()),
+		Delete: &types.Delete{Objects: objs, Quiet: aws.Bool(true)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var errs MultiRemoveError
+	for _, e := range out.Errors {
+		errs = append(errs, &RemoveError{
+			Key:     aws.ToString(e.Key),
+			Code:    aws.ToString(e.Code),
+			Message: aws.ToString(e.Message),
+		})
+	}
+	return errs, nil
+}
+
+func (fs *S3FS) removeConcurrency() int {
+	if fs.config.RemoveConcurrency > 0 {
+		return fs.config.RemoveConcurrency
+	}
+	return 1
+}
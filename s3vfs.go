@@ -2,127 +2,194 @@ package s3vfs
 
 import (
 	"bytes"
-	"encoding/xml"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"net/url"
 	"os"
 	pathpkg "path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/tools/godoc/vfs"
 
-	"strings"
-
-	"github.com/sqs/s3"
-	"github.com/sqs/s3/s3util"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"sourcegraph.com/sourcegraph/rwvfs"
 )
 
-var DefaultS3Config = s3util.Config{
-	Keys: &s3.Keys{
-		AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
-		SecretKey: os.Getenv("AWS_SECRET_KEY"),
-	},
-	Service: s3.DefaultService,
-}
-
 // S3 returns an implementation of FileSystem using the specified S3 bucket and
-// config. If config is nil, DefaultS3Config is used.
+// config. If config is nil, DefaultConfig is used.
 //
 // The bucket URL is the full URL to the bucket on Amazon S3, including the
 // bucket name and AWS region (e.g.,
-// https://s3-us-west-2.amazonaws.com/mybucket).
-func S3(bucket *url.URL, config *s3util.Config) rwvfs.FileSystem {
+// https://s3-us-west-2.amazonaws.com/mybucket), and optionally a path prefix
+// within the bucket.
+//
+// Only the URL's path (bucket name and prefix) is used to address objects;
+// the region and endpoint requests are sent to come from config, not from
+// the URL's host.
+func S3(bucket *url.URL, config *Config) rwvfs.FileSystem {
 	if config == nil {
-		config = &DefaultS3Config
+		config = DefaultConfig
 	}
-	return &S3FS{bucket, config}
+	return &S3FS{bucket: bucket, config: config}
 }
 
 type S3FS struct {
 	bucket *url.URL
-	config *s3util.Config
+	config *Config
+
+	clientOnce sync.Once
+	s3Client   *s3.Client
+	clientErr  error
 }
 
 func (fs *S3FS) String() string {
 	return fmt.Sprintf("S3 filesystem at %s", fs.bucket)
 }
 
+// client lazily constructs (and caches) the underlying SDK client, since
+// building it can involve network calls (e.g. resolving instance metadata
+// credentials or assuming a role).
+func (fs *S3FS) client(ctx context.Context) (*s3.Client, error) {
+	fs.clientOnce.Do(func() {
+		fs.s3Client, fs.clientErr = fs.config.newClient(ctx)
+	})
+	return fs.s3Client, fs.clientErr
+}
+
+// bucketName returns the S3 bucket name, taken from the first path segment
+// of fs.bucket.
+func (fs *S3FS) bucketName() string {
+	trimmed := strings.TrimPrefix(fs.bucket.Path, "/")
+	if i := strings.Index(trimmed, "/"); i >= 0 {
+		return trimmed[:i]
+	}
+	return trimmed
+}
+
+// key returns the S3 object key for path, combining it with any path prefix
+// in fs.bucket beyond the bucket name.
+func (fs *S3FS) key(path string) string {
+	if path == "." {
+		path = ""
+	}
+	trimmed := strings.TrimPrefix(fs.bucket.Path, "/")
+	prefix := ""
+	if i := strings.Index(trimmed, "/"); i >= 0 {
+		prefix = trimmed[i+1:]
+	}
+	return strings.TrimPrefix(pathpkg.Join(prefix, path), "/")
+}
+
 func (fs *S3FS) url(path string) string {
 	path = pathpkg.Join(fs.bucket.Path, path)
 	return fs.bucket.ResolveReference(&url.URL{Path: path}).String()
 }
 
+// Open returns a lazy reader over the named object: it issues no requests
+// until the first Read, Seek, or ReadAt, and never buffers the object in
+// full. See s3Reader for the range-fetch and read-ahead strategy.
 func (fs *S3FS) Open(name string) (vfs.ReadSeekCloser, error) {
-	return fs.open(name, "")
+	ctx := context.Background()
+	if _, err := fs.client(ctx); err != nil {
+		return nil, err
+	}
+	return &s3Reader{
+		ctx:       ctx,
+		fs:        fs,
+		name:      name,
+		size:      -1,
+		readAhead: fs.readAheadSize(),
+	}, nil
 }
 
-type rangeTransport struct {
-	http.RoundTripper
-	rangeVal string
+// OpenVersion is like Open, but reads a specific, possibly non-current,
+// object version (see ListVersions).
+func (fs *S3FS) OpenVersion(name, versionID string) (vfs.ReadSeekCloser, error) {
+	ctx := context.Background()
+	if _, err := fs.client(ctx); err != nil {
+		return nil, err
+	}
+	return &s3Reader{
+		ctx:       ctx,
+		fs:        fs,
+		name:      name,
+		versionID: versionID,
+		size:      -1,
+		readAhead: fs.readAheadSize(),
+	}, nil
 }
 
-func (t rangeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	req = cloneRequest(req)
-	req.Header.Set("range", t.rangeVal)
+// getRange fetches byte range [start, endInclusive] of the named object. If
+// versionID is non-empty, that specific object version is fetched instead
+// of the current one.
+func (fs *S3FS) getRange(ctx context.Context, name, versionID string, start, endInclusive int64) ([]byte, error) {
+	client, err := fs.client(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	transport := t.RoundTripper
-	if transport == nil {
-		transport = http.DefaultTransport
+	in := &s3.GetObjectInput{
+		Bucket: aws.String(fs.bucketName()),
+		Key:    aws.String(fs.key(name)),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", start, endInclusive)),
+	}
+	if versionID != "" {
+		in.VersionId = aws.String(versionID)
 	}
 
-	resp, err := transport.RoundTrip(req)
-	if resp != nil && resp.StatusCode == http.StatusPartialContent {
-		resp.StatusCode = http.StatusOK
+	out, err := client.GetObject(ctx, in)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, &os.PathError{Op: "open", Path: fs.url(name), Err: os.ErrNotExist}
+		}
+		return nil, &os.PathError{Op: "open", Path: fs.url(name), Err: err}
 	}
-	return resp, err
-}
+	defer out.Body.Close()
 
-// cloneRequest returns a clone of the provided *http.Request. The clone is a
-// shallow copy of the struct and its Header map.
-func cloneRequest(r *http.Request) *http.Request {
-	// shallow copy of the struct
-	r2 := new(http.Request)
-	*r2 = *r
-	// deep copy of the Header
-	r2.Header = make(http.Header)
-	for k, s := range r.Header {
-		r2.Header[k] = s
-	}
-	return r2
+	return ioutil.ReadAll(out.Body)
 }
 
-func (fs *S3FS) open(name string, rangeHeader string) (vfs.ReadSeekCloser, error) {
-	cfg := fs.config
-	if rangeHeader != "" {
-		tmp := *cfg
-		cfg = &tmp
-		var existingTransport http.RoundTripper
-		if cfg.Client != nil {
-			existingTransport = cfg.Client.Transport
-		}
-		cfg.Client = &http.Client{Transport: rangeTransport{RoundTripper: existingTransport, rangeVal: rangeHeader}}
+// headContentLength fetches the named object's size via HEAD, used to
+// support Seek(whence=io.SeekEnd) without reading the object body. If
+// versionID is non-empty, that specific object version is inspected instead
+// of the current one.
+func (fs *S3FS) headContentLength(ctx context.Context, name, versionID string) (int64, error) {
+	client, err := fs.client(ctx)
+	if err != nil {
+		return 0, err
 	}
 
-	rdr, err := s3util.Open(fs.url(name), cfg)
-	if err != nil {
-		return nil, &os.PathError{Op: "open", Path: fs.url(name), Err: err}
+	in := &s3.HeadObjectInput{
+		Bucket: aws.String(fs.bucketName()),
+		Key:    aws.String(fs.key(name)),
+	}
+	if versionID != "" {
+		in.VersionId = aws.String(versionID)
 	}
 
-	b, err := ioutil.ReadAll(rdr)
+	out, err := client.HeadObject(ctx, in)
 	if err != nil {
-		return nil, err
+		if isNotFound(err) {
+			return 0, &os.PathError{Op: "open", Path: fs.url(name), Err: os.ErrNotExist}
+		}
+		return 0, &os.PathError{Op: "open", Path: fs.url(name), Err: err}
 	}
-	defer rdr.Close()
-	return nopCloser{bytes.NewReader(b)}, nil
+	return aws.ToInt64(out.ContentLength), nil
 }
 
+// OpenFetcher returns a ReadSeekCloser that only fetches the byte ranges
+// explicitly requested via Fetch (or, with autofetch, overfetched ranges
+// around each Read), as opposed to Open's read-ahead window.
 func (fs *S3FS) OpenFetcher(name string) (vfs.ReadSeekCloser, error) {
 	return &explicitFetchFile{name: name, fs: fs, autofetch: true}, nil
 }
@@ -172,10 +239,9 @@ func (f *explicitFetchFile) Fetch(start, end int64) error {
 		return err
 	}
 
-	rng := fmt.Sprintf("bytes=%d-%d", start, end)
-	var err error
-	f.rc, err = f.fs.open(f.name, rng)
+	data, err := f.fs.getRange(context.Background(), f.name, "", start, end)
 	if err == nil {
+		f.rc = nopCloser{bytes.NewReader(data)}
 		f.startByte = start
 		f.endByte = end
 	}
@@ -211,37 +277,15 @@ func (f *explicitFetchFile) Close() error {
 	return nil
 }
 
-func (fs *S3FS) ReadDir(path string) ([]os.FileInfo, error) {
-	dir, err := s3util.NewFile(fs.url(path), fs.config)
-	if err != nil {
-		return nil, &os.PathError{Op: "readdir", Path: fs.url(path), Err: err}
-	}
-
-	fis, err := dir.Readdir(0)
-	if err != nil {
-		return nil, err
-	}
-	for i, fi := range fis {
-		fis[i] = &fileInfo{
-			name:    pathpkg.Base(fi.Name()),
-			size:    fi.Size(),
-			mode:    fi.Mode(),
-			modTime: fi.ModTime(),
-			sys:     fi.Sys(),
-		}
-	}
-	return fis, nil
-}
-
 func (fs *S3FS) Lstat(name string) (os.FileInfo, error) {
-	fi, err := fs.lstat(name)
+	fi, err := fs.lstat(context.Background(), name)
 	if err != nil {
 		return nil, &os.PathError{Op: "lstat", Path: fs.url(name), Err: err}
 	}
 	return fi, nil
 }
 
-func (fs *S3FS) lstat(name string) (os.FileInfo, error) {
+func (fs *S3FS) lstat(ctx context.Context, name string) (os.FileInfo, error) {
 	name = strings.TrimPrefix(filepath.Clean(name), "/")
 
 	if name == "." {
@@ -253,42 +297,22 @@ func (fs *S3FS) lstat(name string) (os.FileInfo, error) {
 		}, nil
 	}
 
-	client := fs.config.Client
-	if client == nil {
-		client = http.DefaultClient
-	}
-
-	q := make(url.Values)
-	q.Set("prefix", name+"/")
-	q.Set("max-keys", "1")
-	u := fs.bucket.ResolveReference(&url.URL{RawQuery: q.Encode()})
-
-	req, err := http.NewRequest("GET", u.String(), nil)
+	client, err := fs.client(ctx)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
-	fs.config.Sign(req, *fs.config.Keys)
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != 200 {
-		resp.Body.Close()
-		return nil, newRespError(resp)
-	}
-
-	result := struct{ Contents []struct{ Key string } }{}
-	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
-	}
 
-	if err := resp.Body.Close(); err != nil {
+	listOut, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(fs.bucketName()),
+		Prefix:  aws.String(fs.key(name) + "/"),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	// If Contents is non-empty, then this is a dir.
-	if len(result.Contents) == 1 {
+	// If the listing is non-empty, then this is a dir.
+	if len(listOut.Contents) > 0 {
 		return &fileInfo{
 			name: name,
 			size: 0,
@@ -297,28 +321,22 @@ func (fs *S3FS) lstat(name string) (os.FileInfo, error) {
 	}
 
 	// Otherwise, see if a key exists here.
-	req, err = http.NewRequest("HEAD", fs.url(name), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
-	fs.config.Sign(req, *fs.config.Keys)
-	resp, err = client.Do(req)
+	headOut, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(fs.bucketName()),
+		Key:    aws.String(fs.key(name)),
+	})
 	if err != nil {
+		if isNotFound(err) {
+			return nil, os.ErrNotExist
+		}
 		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, os.ErrNotExist
-	} else if resp.StatusCode != 200 {
-		return nil, newRespError(resp)
-	}
-	t, _ := time.Parse(http.TimeFormat, resp.Header.Get("last-modified"))
+
 	return &fileInfo{
 		name:    name,
-		size:    resp.ContentLength,
+		size:    aws.ToInt64(headOut.ContentLength),
 		mode:    0, // file
-		modTime: t,
+		modTime: aws.ToTime(headOut.LastModified),
 	}, nil
 }
 
@@ -326,16 +344,6 @@ func (fs *S3FS) Stat(name string) (os.FileInfo, error) {
 	return fs.Lstat(name)
 }
 
-// Create opens the file at path for writing, creating the file if it doesn't
-// exist and truncating it otherwise.
-func (fs *S3FS) Create(path string) (io.WriteCloser, error) {
-	wc, err := s3util.Create(fs.url(path), nil, fs.config)
-	if err != nil {
-		return nil, &os.PathError{Op: "create", Path: fs.url(path), Err: err}
-	}
-	return wc, nil
-}
-
 func (fs *S3FS) Mkdir(name string) error {
 	// S3 doesn't have directories.
 	return nil
@@ -347,18 +355,40 @@ func (fs *S3FS) MkdirAll(name string) error {
 	return nil
 }
 
-func (fs *S3FS) Remove(name string) (err error) {
-	var rdr io.ReadCloser
-	rdr, err = s3util.Delete(fs.url(name), fs.config)
-	defer func() {
-		if rdr != nil {
-			err2 := rdr.Close()
-			if err == nil {
-				err = err2
-			}
-		}
-	}()
-	return err
+func (fs *S3FS) Remove(name string) error {
+	ctx := context.Background()
+	client, err := fs.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(fs.bucketName()),
+		Key:    aws.String(fs.key(name)),
+	})
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: fs.url(name), Err: err}
+	}
+	return nil
+}
+
+// isNotFound reports whether err represents an HTTP 404 response from S3,
+// which the SDK surfaces differently depending on the operation (a modeled
+// NotFound/NoSuchKey error, or a bare HTTP response error).
+func isNotFound(err error) bool {
+	var nf *types.NotFound
+	if errors.As(err, &nf) {
+		return true
+	}
+	var nsk *types.NoSuchKey
+	if errors.As(err, &nsk) {
+		return true
+	}
+	var re *smithyhttp.ResponseError
+	if errors.As(err, &re) {
+		return re.HTTPStatusCode() == 404
+	}
+	return false
 }
 
 type nopCloser struct {
@@ -381,24 +411,3 @@ func (f *fileInfo) Mode() os.FileMode  { return f.mode }
 func (f *fileInfo) ModTime() time.Time { return f.modTime }
 func (f *fileInfo) IsDir() bool        { return f.mode&os.ModeDir != 0 }
 func (f *fileInfo) Sys() interface{}   { return f.sys }
-
-type respError struct {
-	r *http.Response
-	b bytes.Buffer
-}
-
-func newRespError(r *http.Response) *respError {
-	e := new(respError)
-	e.r = r
-	io.Copy(&e.b, r.Body)
-	r.Body.Close()
-	return e
-}
-
-func (e *respError) Error() string {
-	return fmt.Sprintf(
-		"unwanted http status %d: %q",
-		e.r.StatusCode,
-		e.b.String(),
-	)
-}
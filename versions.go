@@ -0,0 +1,118 @@
+package s3vfs
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// FileVersion is the os.FileInfo.Sys() value for entries returned by
+// ListVersions, letting callers round-trip the version ID (e.g. into
+// OpenVersion or RemoveVersion) without re-listing.
+type FileVersion struct {
+	VersionID    string
+	IsLatest     bool
+	DeleteMarker bool
+}
+
+// ListVersions lists every version of every object with the given prefix,
+// following pagination (KeyMarker/VersionIdMarker) until the listing is
+// exhausted. Each returned os.FileInfo's Sys() is a *FileVersion.
+func (fs *S3FS) ListVersions(prefix string) ([]os.FileInfo, error) {
+	ctx := context.Background()
+	client, err := fs.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fs.key(prefix)
+
+	var fis []os.FileInfo
+	var keyMarker, versionIDMarker *string
+	for {
+		out, err := client.ListObjectVersions(ctx, &s3.ListObjectVersionsInput{
+			Bucket:          aws.String(fs.bucketName()),
+			Prefix:          aws.String(key),
+			KeyMarker:       keyMarker,
+			VersionIdMarker: versionIDMarker,
+		})
+		if err != nil {
+			return nil, &os.PathError{Op: "listversions", Path: fs.url(prefix), Err: err}
+		}
+
+		for _, v := range out.Versions {
+			fis = append(fis, &fileInfo{
+				name:    strings.TrimPrefix(aws.ToString(v.Key), key),
+				size:    aws.ToInt64(v.Size),
+				modTime: aws.ToTime(v.LastModified),
+				sys: &FileVersion{
+					VersionID: aws.ToString(v.VersionId),
+					IsLatest:  aws.ToBool(v.IsLatest),
+				},
+			})
+		}
+		for _, d := range out.DeleteMarkers {
+			fis = append(fis, &fileInfo{
+				name:    strings.TrimPrefix(aws.ToString(d.Key), key),
+				modTime: aws.ToTime(d.LastModified),
+				sys: &FileVersion{
+					VersionID:    aws.ToString(d.VersionId),
+					IsLatest:     aws.ToBool(d.IsLatest),
+					DeleteMarker: true,
+				},
+			})
+		}
+
+		if !aws.ToBool(out.IsTruncated) {
+			break
+		}
+		keyMarker = out.NextKeyMarker
+		versionIDMarker = out.NextVersionIdMarker
+	}
+	return fis, nil
+}
+
+// RemoveVersion removes a specific object version, as opposed to Remove
+// (which removes the current version, or places a delete marker on a
+// versioned bucket).
+func (fs *S3FS) RemoveVersion(name, versionID string) error {
+	ctx := context.Background()
+	client, err := fs.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:    aws.String(fs.bucketName()),
+		Key:       aws.String(fs.key(name)),
+		VersionId: aws.String(versionID),
+	})
+	if err != nil {
+		return &os.PathError{Op: "removeversion", Path: fs.url(name), Err: err}
+	}
+	return nil
+}
+
+// BucketVersioning reports the bucket's versioning state. An empty
+// types.BucketVersioningStatus means versioning has never been enabled on
+// the bucket (as opposed to types.BucketVersioningStatusSuspended, meaning
+// it was enabled and then turned off).
+func (fs *S3FS) BucketVersioning() (types.BucketVersioningStatus, error) {
+	ctx := context.Background()
+	client, err := fs.client(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+		Bucket: aws.String(fs.bucketName()),
+	})
+	if err != nil {
+		return "", err
+	}
+	return out.Status, nil
+}